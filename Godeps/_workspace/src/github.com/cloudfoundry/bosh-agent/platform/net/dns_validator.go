@@ -0,0 +1,114 @@
+package net
+
+import (
+	"strings"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshdnsresolver "github.com/cloudfoundry/bosh-agent/platform/net/dnsresolver"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+// DNSValidator confirms that nameservers we configured actually took effect.
+// resolvconf, NetworkManager, or systemd-resolved can overwrite our
+// resolv.conf on some cloud images, so writing the file successfully isn't
+// proof that the agent will actually resolve anything through it.
+type DNSValidator interface {
+	Validate(dnsServers []string) error
+}
+
+// dnsValidator reads back the resolv.conf-format file in which the configured
+// DNSResolver backend's nameservers end up. It must be given the same DNSResolverType as the
+// DNSResolver passed to NewUbuntuNetManager, otherwise it ends up checking a
+// file some other resolver wrote (or never wrote).
+type dnsValidator struct {
+	fs           boshsys.FileSystem
+	resolverType boshdnsresolver.DNSResolverType
+}
+
+func NewDNSValidator(fs boshsys.FileSystem, resolverType boshdnsresolver.DNSResolverType) DNSValidator {
+	return dnsValidator{fs: fs, resolverType: resolverType}
+}
+
+const (
+	dnsValidationRetryDelay  = 1 * time.Second
+	dnsValidationMaxAttempts = 10
+)
+
+func (v dnsValidator) Validate(dnsServers []string) error {
+	if len(dnsServers) == 0 {
+		return nil
+	}
+
+	var err error
+
+	for attempt := 0; attempt < dnsValidationMaxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(dnsValidationRetryDelay)
+		}
+
+		err = v.checkServersPresent(dnsServers)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return bosherr.WrapError(err, "Validating DNS configuration")
+}
+
+func (v dnsValidator) checkServersPresent(dnsServers []string) error {
+	effective, err := v.effectiveNameservers()
+	if err != nil {
+		return err
+	}
+
+	for _, server := range dnsServers {
+		if !stringInSlice(server, effective) {
+			return bosherr.Errorf("Nameserver '%s' is not present in effective DNS configuration", server)
+		}
+	}
+
+	return nil
+}
+
+// effectiveNameservers reads the file in which the configured DNSResolver
+// backend's nameservers end up, not whichever resolver file merely happens to exist --
+// systemd-resolved maintains /run/systemd/resolve/resolv.conf from its own
+// upstream view any time it's running, regardless of which backend bosh-agent
+// was told to use, so existence alone can't tell us which file is ours.
+func (v dnsValidator) effectiveNameservers() ([]string, error) {
+	path, err := boshdnsresolver.EffectiveResolvConfPath(v.resolverType)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.parseResolvConf(path)
+}
+
+func (v dnsValidator) parseResolvConf(path string) ([]string, error) {
+	contents, err := v.fs.ReadFileString(path)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Reading %s", path)
+	}
+
+	servers := []string{}
+
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+
+	return servers, nil
+}
+
+func stringInSlice(needle string, haystack []string) bool {
+	for _, candidate := range haystack {
+		if candidate == needle {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,13 @@
+package dnsresolver
+
+// DNSResolver configures the system's DNS nameservers. Stemcells differ in
+// which component owns /etc/resolv.conf (plain resolv.conf, resolvconf,
+// systemd-resolved), so the net manager is given a DNSResolver rather than
+// writing /etc/resolv.conf itself.
+type DNSResolver interface {
+	BuildWithDNSServers(servers []string) error
+}
+
+type dnsConfigArg struct {
+	DNSServers []string
+}
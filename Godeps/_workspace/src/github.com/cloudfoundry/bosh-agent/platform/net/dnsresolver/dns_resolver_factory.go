@@ -0,0 +1,64 @@
+package dnsresolver
+
+import (
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+// DNSResolverType names the DNSResolver backend to build, matching the
+// agent config's `DNSResolverType` setting.
+type DNSResolverType string
+
+const (
+	// DNSResolverTypeResolvConf writes /etc/resolv.conf directly. This is
+	// the historical bosh-agent default.
+	DNSResolverTypeResolvConf DNSResolverType = "resolvconf"
+
+	// DNSResolverTypeResolvConfHead writes the resolvconf "head" file and
+	// lets resolvconf regenerate /etc/resolv.conf.
+	DNSResolverTypeResolvConfHead DNSResolverType = "resolvconf-head"
+
+	// DNSResolverTypeSystemd configures systemd-resolved, for stemcells
+	// where it owns /etc/resolv.conf (e.g. Ubuntu Jammy).
+	DNSResolverTypeSystemd DNSResolverType = "systemd"
+)
+
+// NewDNSResolver builds the DNSResolver named by resolverType. An empty
+// resolverType defaults to DNSResolverTypeResolvConf so existing agent
+// configs that predate this setting keep their current behavior.
+func NewDNSResolver(
+	resolverType DNSResolverType,
+	fs boshsys.FileSystem,
+	cmdRunner boshsys.CmdRunner,
+	logger boshlog.Logger,
+) (DNSResolver, error) {
+	switch resolverType {
+	case "", DNSResolverTypeResolvConf:
+		return NewResolvConfResolver(fs, logger), nil
+	case DNSResolverTypeResolvConfHead:
+		return NewResolvConfHeadResolver(fs, cmdRunner, logger), nil
+	case DNSResolverTypeSystemd:
+		return NewSystemdResolver(fs, cmdRunner, logger), nil
+	default:
+		return nil, bosherr.Errorf("Unknown DNS resolver type '%s'", resolverType)
+	}
+}
+
+// EffectiveResolvConfPath returns the resolv.conf-format file in which the
+// named backend's nameservers end up: /etc/resolv.conf, which the
+// resolvconf backend writes directly and resolvconf regenerates from the
+// head file, or /run/systemd/resolve/resolv.conf, which systemd-resolved
+// generates from the resolved.conf the systemd backend writes. Callers that
+// read back the effective DNS configuration (e.g. DNSValidator) use it
+// rather than re-deriving the path.
+func EffectiveResolvConfPath(resolverType DNSResolverType) (string, error) {
+	switch resolverType {
+	case "", DNSResolverTypeResolvConf, DNSResolverTypeResolvConfHead:
+		return "/etc/resolv.conf", nil
+	case DNSResolverTypeSystemd:
+		return "/run/systemd/resolve/resolv.conf", nil
+	default:
+		return "", bosherr.Errorf("Unknown DNS resolver type '%s'", resolverType)
+	}
+}
@@ -0,0 +1,57 @@
+package dnsresolver
+
+import (
+	"bytes"
+	"text/template"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+const resolvConfHeadResolverLogTag = "ResolvConfHeadResolver"
+
+// ResolvConfHeadResolver writes the resolvconf "head" file and asks
+// resolvconf to regenerate /etc/resolv.conf, for stemcells where resolvconf
+// owns that file and a direct write would be clobbered.
+type ResolvConfHeadResolver struct {
+	fs        boshsys.FileSystem
+	cmdRunner boshsys.CmdRunner
+	logger    boshlog.Logger
+}
+
+func NewResolvConfHeadResolver(fs boshsys.FileSystem, cmdRunner boshsys.CmdRunner, logger boshlog.Logger) ResolvConfHeadResolver {
+	return ResolvConfHeadResolver{
+		fs:        fs,
+		cmdRunner: cmdRunner,
+		logger:    logger,
+	}
+}
+
+func (r ResolvConfHeadResolver) BuildWithDNSServers(servers []string) error {
+	r.logger.Debug(resolvConfHeadResolverLogTag, "Writing resolvconf head")
+
+	buffer := bytes.NewBuffer([]byte{})
+	t := template.Must(template.New("resolvconf-head").Parse(resolvConfHeadTemplate))
+
+	err := t.Execute(buffer, dnsConfigArg{servers})
+	if err != nil {
+		return bosherr.WrapError(err, "Generating config from template")
+	}
+
+	err = r.fs.WriteFile("/etc/resolvconf/resolv.conf.d/head", buffer.Bytes())
+	if err != nil {
+		return bosherr.WrapError(err, "Writing to /etc/resolvconf/resolv.conf.d/head")
+	}
+
+	_, _, _, err = r.cmdRunner.RunCommand("resolvconf", "-u")
+	if err != nil {
+		return bosherr.WrapError(err, "Updating resolvconf")
+	}
+
+	return nil
+}
+
+const resolvConfHeadTemplate = `# Generated by bosh-agent
+{{ range .DNSServers }}nameserver {{ . }}
+{{ end }}`
@@ -0,0 +1,49 @@
+package dnsresolver
+
+import (
+	"bytes"
+	"text/template"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+const resolvConfResolverLogTag = "ResolvConfResolver"
+
+// ResolvConfResolver writes /etc/resolv.conf directly. This is correct on
+// stemcells where nothing else manages that file.
+type ResolvConfResolver struct {
+	fs     boshsys.FileSystem
+	logger boshlog.Logger
+}
+
+func NewResolvConfResolver(fs boshsys.FileSystem, logger boshlog.Logger) ResolvConfResolver {
+	return ResolvConfResolver{
+		fs:     fs,
+		logger: logger,
+	}
+}
+
+func (r ResolvConfResolver) BuildWithDNSServers(servers []string) error {
+	r.logger.Debug(resolvConfResolverLogTag, "Writing resolv.conf")
+
+	buffer := bytes.NewBuffer([]byte{})
+	t := template.Must(template.New("resolv-conf").Parse(resolvConfTemplate))
+
+	err := t.Execute(buffer, dnsConfigArg{servers})
+	if err != nil {
+		return bosherr.WrapError(err, "Generating config from template")
+	}
+
+	err = r.fs.WriteFile("/etc/resolv.conf", buffer.Bytes())
+	if err != nil {
+		return bosherr.WrapError(err, "Writing to /etc/resolv.conf")
+	}
+
+	return nil
+}
+
+const resolvConfTemplate = `# Generated by bosh-agent
+{{ range .DNSServers }}nameserver {{ . }}
+{{ end }}`
@@ -0,0 +1,58 @@
+package dnsresolver
+
+import (
+	"bytes"
+	"text/template"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+const systemdResolverLogTag = "SystemdResolver"
+
+// SystemdResolver configures DNS on stemcells where systemd-resolved owns
+// /etc/resolv.conf (e.g. Ubuntu Jammy), so writing that file directly is
+// either ignored or clobbered by the service.
+type SystemdResolver struct {
+	fs        boshsys.FileSystem
+	cmdRunner boshsys.CmdRunner
+	logger    boshlog.Logger
+}
+
+func NewSystemdResolver(fs boshsys.FileSystem, cmdRunner boshsys.CmdRunner, logger boshlog.Logger) SystemdResolver {
+	return SystemdResolver{
+		fs:        fs,
+		cmdRunner: cmdRunner,
+		logger:    logger,
+	}
+}
+
+func (r SystemdResolver) BuildWithDNSServers(servers []string) error {
+	r.logger.Debug(systemdResolverLogTag, "Configuring systemd-resolved")
+
+	buffer := bytes.NewBuffer([]byte{})
+	t := template.Must(template.New("resolved-conf").Parse(resolvedConfTemplate))
+
+	err := t.Execute(buffer, dnsConfigArg{servers})
+	if err != nil {
+		return bosherr.WrapError(err, "Generating config from template")
+	}
+
+	err = r.fs.WriteFile("/etc/systemd/resolved.conf", buffer.Bytes())
+	if err != nil {
+		return bosherr.WrapError(err, "Writing to /etc/systemd/resolved.conf")
+	}
+
+	_, _, _, err = r.cmdRunner.RunCommand("systemctl", "restart", "systemd-resolved")
+	if err != nil {
+		return bosherr.WrapError(err, "Restarting systemd-resolved")
+	}
+
+	return nil
+}
+
+const resolvedConfTemplate = `# Generated by bosh-agent
+[Resolve]
+{{ if .DNSServers }}DNS={{ range $i, $s := .DNSServers }}{{ if $i }} {{ end }}{{ $s }}{{ end }}{{ end }}
+`
@@ -0,0 +1,154 @@
+package net
+
+import (
+	"net"
+	"sort"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsettings "github.com/cloudfoundry/bosh-agent/settings"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+const interfaceConfigurationCreatorLogTag = "InterfaceConfigurationCreator"
+
+// StaticInterfaceConfiguration describes an interface that should be
+// configured with a fixed IP address. IsIPv6 selects between an
+// "inet static" and an "inet6 static" stanza; Network and Broadcast are only
+// meaningful for IPv4, where Netmask is a dotted-decimal mask rather than an
+// IPv6 prefix length.
+type StaticInterfaceConfiguration struct {
+	Name      string
+	Address   string
+	Netmask   string
+	Network   string
+	Broadcast string
+	Mac       string
+	Gateway   string
+	IsIPv6    bool
+}
+
+func isIPv6(address string) bool {
+	parsed := net.ParseIP(address)
+	return parsed != nil && parsed.To4() == nil
+}
+
+// DHCPInterfaceConfiguration describes an interface whose address is
+// obtained from a DHCP server.
+type DHCPInterfaceConfiguration struct {
+	Name string
+}
+
+type InterfaceConfigurationCreator struct {
+	logger boshlog.Logger
+}
+
+func NewInterfaceConfigurationCreator(logger boshlog.Logger) InterfaceConfigurationCreator {
+	return InterfaceConfigurationCreator{logger: logger}
+}
+
+// CreateInterfaceConfigurations matches each network to its detected MAC
+// address and classifies it as static or DHCP, so a deployment can mix both
+// kinds of interface on the same VM. This is network-driven, not
+// interface-driven: a network with no mac address (legacy manifests that
+// never set one) falls back to whichever detected interface no other
+// network has claimed, in a stable order, but unlike the old SetupDhcp path
+// a detected interface that no network claims at all gets no stanza -- it's
+// left alone rather than being DHCP'd.
+func (creator InterfaceConfigurationCreator) CreateInterfaceConfigurations(
+	networks boshsettings.Networks,
+	macAddresses map[string]string,
+) ([]StaticInterfaceConfiguration, []DHCPInterfaceConfiguration, error) {
+	staticConfigs := []StaticInterfaceConfiguration{}
+	dhcpConfigs := []DHCPInterfaceConfiguration{}
+
+	// networks is a map, so iterate its keys in a stable order -- otherwise
+	// which unclaimed interface a mac-less network gets could change from
+	// one agent run to the next.
+	networkNames := make([]string, 0, len(networks))
+	for name := range networks {
+		networkNames = append(networkNames, name)
+	}
+	sort.Strings(networkNames)
+
+	unclaimedMacs := make([]string, 0, len(macAddresses))
+	for mac := range macAddresses {
+		unclaimedMacs = append(unclaimedMacs, mac)
+	}
+	sort.Strings(unclaimedMacs)
+
+	claim := func(mac string) {
+		for i, candidate := range unclaimedMacs {
+			if candidate == mac {
+				unclaimedMacs = append(unclaimedMacs[:i], unclaimedMacs[i+1:]...)
+				return
+			}
+		}
+	}
+
+	// Claim interfaces pinned by an explicit mac first, so a mac-less
+	// network below can't steal an interface another network needs.
+	for _, name := range networkNames {
+		if networks[name].Mac != "" {
+			claim(networks[name].Mac)
+		}
+	}
+
+	for _, name := range networkNames {
+		networkSettings := networks[name]
+		var interfaceName string
+
+		if networkSettings.Mac == "" {
+			if len(unclaimedMacs) == 0 {
+				return nil, nil, bosherr.Errorf("Failed to find an unclaimed interface for network without a mac address")
+			}
+
+			interfaceName = macAddresses[unclaimedMacs[0]]
+			unclaimedMacs = unclaimedMacs[1:]
+		} else {
+			interfaceName = macAddresses[networkSettings.Mac]
+			if interfaceName == "" {
+				return nil, nil, bosherr.Errorf("Failed to find interface for mac address '%s'", networkSettings.Mac)
+			}
+		}
+
+		if networkSettings.IsDHCP() || networkSettings.Mac == "" {
+			creator.logger.Debug(interfaceConfigurationCreatorLogTag, "Using DHCP for interface '%s'", interfaceName)
+			dhcpConfigs = append(dhcpConfigs, DHCPInterfaceConfiguration{Name: interfaceName})
+			continue
+		}
+
+		creator.logger.Debug(interfaceConfigurationCreatorLogTag, "Using static networking for interface '%s'", interfaceName)
+
+		if isIPv6(networkSettings.IP) {
+			// IPv6 has no broadcast address and Netmask is already a
+			// prefix length (e.g. "64"), so there's nothing to calculate.
+			staticConfigs = append(staticConfigs, StaticInterfaceConfiguration{
+				Name:    interfaceName,
+				Address: networkSettings.IP,
+				Netmask: networkSettings.Netmask,
+				Mac:     networkSettings.Mac,
+				Gateway: networkSettings.Gateway,
+				IsIPv6:  true,
+			})
+			continue
+		}
+
+		network, broadcast, err := boshsys.CalculateNetworkAndBroadcast(networkSettings.IP, networkSettings.Netmask)
+		if err != nil {
+			return nil, nil, bosherr.WrapError(err, "Calculating network and broadcast")
+		}
+
+		staticConfigs = append(staticConfigs, StaticInterfaceConfiguration{
+			Name:      interfaceName,
+			Address:   networkSettings.IP,
+			Netmask:   networkSettings.Netmask,
+			Network:   network,
+			Broadcast: broadcast,
+			Mac:       networkSettings.Mac,
+			Gateway:   networkSettings.Gateway,
+		})
+	}
+
+	return staticConfigs, dhcpConfigs, nil
+}
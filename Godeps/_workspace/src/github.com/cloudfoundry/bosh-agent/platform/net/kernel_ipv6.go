@@ -0,0 +1,45 @@
+package net
+
+import (
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+const kernelIPv6LogTag = "KernelIPv6"
+
+// KernelIPv6 clears the kernel's disable_ipv6 sysctls so a deployment that
+// adds an IPv6 network to a stemcell that ships with IPv6 disabled actually
+// gets an interface, rather than silently staying IPv4-only.
+type KernelIPv6 struct {
+	fs        boshsys.FileSystem
+	cmdRunner boshsys.CmdRunner
+	logger    boshlog.Logger
+}
+
+func NewKernelIPv6(fs boshsys.FileSystem, cmdRunner boshsys.CmdRunner, logger boshlog.Logger) KernelIPv6 {
+	return KernelIPv6{fs: fs, cmdRunner: cmdRunner, logger: logger}
+}
+
+func (k KernelIPv6) Enable() error {
+	k.logger.Debug(kernelIPv6LogTag, "Enabling IPv6")
+
+	err := k.fs.WriteFile("/etc/sysctl.d/60-bosh-ipv6.conf", []byte(sysctlIPv6Config))
+	if err != nil {
+		return bosherr.WrapError(err, "Writing to /etc/sysctl.d/60-bosh-ipv6.conf")
+	}
+
+	for _, key := range []string{"net.ipv6.conf.all.disable_ipv6", "net.ipv6.conf.default.disable_ipv6"} {
+		_, _, _, err := k.cmdRunner.RunCommand("sysctl", "-w", key+"=0")
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Setting %s", key)
+		}
+	}
+
+	return nil
+}
+
+const sysctlIPv6Config = `# Generated by bosh-agent
+net.ipv6.conf.all.disable_ipv6 = 0
+net.ipv6.conf.default.disable_ipv6 = 0
+`
@@ -0,0 +1,51 @@
+package net
+
+import (
+	"path/filepath"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+const linuxMACAddressDetectorLogTag = "LinuxMACAddressDetector"
+
+// LinuxMACAddressDetector reads MAC addresses out of /sys/class/net,
+// skipping virtual interfaces (ones without a "device" symlink).
+type LinuxMACAddressDetector struct {
+	fs     boshsys.FileSystem
+	logger boshlog.Logger
+}
+
+func NewLinuxMACAddressDetector(fs boshsys.FileSystem, logger boshlog.Logger) LinuxMACAddressDetector {
+	return LinuxMACAddressDetector{fs: fs, logger: logger}
+}
+
+func (d LinuxMACAddressDetector) DetectMacAddresses() (map[string]string, error) {
+	addresses := map[string]string{}
+
+	filePaths, err := d.fs.Glob("/sys/class/net/*")
+	if err != nil {
+		return addresses, bosherr.WrapError(err, "Getting file list from /sys/class/net")
+	}
+
+	for _, filePath := range filePaths {
+		if !d.fs.FileExists(filepath.Join(filePath, "device")) {
+			d.logger.Info(linuxMACAddressDetectorLogTag, "Ignoring virtual network device: %s", filePath)
+			continue
+		}
+
+		macAddress, err := d.fs.ReadFileString(filepath.Join(filePath, "address"))
+		if err != nil {
+			return addresses, bosherr.WrapError(err, "Reading mac address from file")
+		}
+
+		macAddress = strings.Trim(macAddress, "\n")
+
+		interfaceName := filepath.Base(filePath)
+		addresses[macAddress] = interfaceName
+	}
+
+	return addresses, nil
+}
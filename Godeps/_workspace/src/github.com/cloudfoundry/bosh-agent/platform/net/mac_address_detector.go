@@ -0,0 +1,9 @@
+package net
+
+// MACAddressDetector maps MAC addresses to the interface names that carry
+// them. Pulled out of ubuntuNetManager so the net manager can be tested
+// without a real sysfs, and so non-Linux stemcells can plug in their own
+// detection strategy.
+type MACAddressDetector interface {
+	DetectMacAddresses() (map[string]string, error)
+}
@@ -0,0 +1,18 @@
+package netfakes
+
+// FakeMACAddressDetector is unused for now: this checkout has no
+// ginkgo/fakesys test scaffolding to wire it into ubuntu_net_manager_test.go
+// (there is no such file here), so it's provided for when that scaffolding
+// is available rather than exercised by a test in this tree.
+type FakeMACAddressDetector struct {
+	DetectMacAddressesAddresses map[string]string
+	DetectMacAddressesErr       error
+}
+
+func NewFakeMACAddressDetector() *FakeMACAddressDetector {
+	return &FakeMACAddressDetector{}
+}
+
+func (d *FakeMACAddressDetector) DetectMacAddresses() (map[string]string, error) {
+	return d.DetectMacAddressesAddresses, d.DetectMacAddressesErr
+}
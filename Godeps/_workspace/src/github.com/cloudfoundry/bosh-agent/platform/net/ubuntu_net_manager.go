@@ -2,13 +2,13 @@ package net
 
 import (
 	"bytes"
-	"path/filepath"
 	"strings"
 	"text/template"
 
 	bosherr "github.com/cloudfoundry/bosh-agent/errors"
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 	bosharp "github.com/cloudfoundry/bosh-agent/platform/net/arp"
+	boshdnsresolver "github.com/cloudfoundry/bosh-agent/platform/net/dnsresolver"
 	boship "github.com/cloudfoundry/bosh-agent/platform/net/ip"
 	boshsettings "github.com/cloudfoundry/bosh-agent/settings"
 	boshsys "github.com/cloudfoundry/bosh-agent/system"
@@ -19,11 +19,16 @@ const ubuntuNetManagerLogTag = "ubuntuNetManager"
 type ubuntuNetManager struct {
 	DefaultNetworkResolver
 
-	cmdRunner          boshsys.CmdRunner
-	fs                 boshsys.FileSystem
-	ipResolver         boship.Resolver
-	addressBroadcaster bosharp.AddressBroadcaster
-	logger             boshlog.Logger
+	cmdRunner                     boshsys.CmdRunner
+	fs                            boshsys.FileSystem
+	ipResolver                    boship.Resolver
+	addressBroadcaster            bosharp.AddressBroadcaster
+	interfaceConfigurationCreator InterfaceConfigurationCreator
+	macAddressDetector            MACAddressDetector
+	dnsResolver                   boshdnsresolver.DNSResolver
+	dnsValidator                  DNSValidator
+	kernelIPv6                    KernelIPv6
+	logger                        boshlog.Logger
 }
 
 func NewUbuntuNetManager(
@@ -32,34 +37,113 @@ func NewUbuntuNetManager(
 	defaultNetworkResolver DefaultNetworkResolver,
 	ipResolver boship.Resolver,
 	addressBroadcaster bosharp.AddressBroadcaster,
+	interfaceConfigurationCreator InterfaceConfigurationCreator,
+	macAddressDetector MACAddressDetector,
+	dnsResolver boshdnsresolver.DNSResolver,
+	dnsValidator DNSValidator,
+	kernelIPv6 KernelIPv6,
 	logger boshlog.Logger,
 ) Manager {
 	return ubuntuNetManager{
-		DefaultNetworkResolver: defaultNetworkResolver,
-		cmdRunner:              cmdRunner,
-		fs:                     fs,
-		ipResolver:             ipResolver,
-		addressBroadcaster:     addressBroadcaster,
-		logger:                 logger,
+		DefaultNetworkResolver:        defaultNetworkResolver,
+		cmdRunner:                     cmdRunner,
+		fs:                            fs,
+		ipResolver:                    ipResolver,
+		addressBroadcaster:            addressBroadcaster,
+		interfaceConfigurationCreator: interfaceConfigurationCreator,
+		macAddressDetector:            macAddressDetector,
+		dnsResolver:                   dnsResolver,
+		dnsValidator:                  dnsValidator,
+		kernelIPv6:                    kernelIPv6,
+		logger:                        logger,
 	}
 }
 
-func (net ubuntuNetManager) SetupDhcp(networks boshsettings.Networks, errCh chan error) error {
-	net.logger.Debug(ubuntuNetManagerLogTag, "Configuring DHCP networking")
+// SetupNetworking classifies every configured network as static or DHCP
+// (a single VM may have both) and renders a single /etc/network/interfaces
+// with one stanza per network (an interface carrying both an IPv4 and an
+// IPv6 network gets one stanza for each).
+func (net ubuntuNetManager) SetupNetworking(networks boshsettings.Networks, errCh chan error) error {
+	net.logger.Debug(ubuntuNetManagerLogTag, "Configuring networking")
 
-	err := net.writeDhcpNetworkInterfaces()
+	staticConfigs, dhcpConfigs, written, err := net.writeNetworkInterfaces(networks)
 	if err != nil {
-		return bosherr.WrapError(err, "Generating interfaces config from template")
+		return bosherr.WrapError(err, "Writing network interfaces")
+	}
+
+	for _, conf := range staticConfigs {
+		if conf.IsIPv6 {
+			err = net.kernelIPv6.Enable()
+			if err != nil {
+				// Don't fail configuration of the rest of the networks
+				// (which may be plain IPv4) over an IPv6-only problem.
+				net.logger.Error(ubuntuNetManagerLogTag, "Ignoring failure enabling IPv6: %s", err.Error())
+			}
+
+			break
+		}
+	}
+
+	dnsNetwork, _ := networks.DefaultNetworkFor("dns")
+
+	err = net.dnsResolver.BuildWithDNSServers(dnsNetwork.DNS)
+	if err != nil {
+		return bosherr.WrapError(err, "Configuring DNS")
+	}
+
+	if len(dhcpConfigs) > 0 {
+		err = net.writeDhclientConfig(dnsNetwork.DNS)
+		if err != nil {
+			return bosherr.WrapError(err, "Writing dhclient config")
+		}
+	}
+
+	if written {
+		net.restartNetworkingInterfaces(staticConfigs, dhcpConfigs)
 	}
 
+	err = net.dnsValidator.Validate(dnsNetwork.DNS)
+	if err != nil {
+		return bosherr.WrapError(err, "Validating DNS configuration")
+	}
+
+	addresses := []boship.InterfaceAddress{}
+
+	for _, conf := range staticConfigs {
+		// Gratuitous ARP is IPv4-only; IPv6 neighbors are updated by NDP,
+		// which the kernel handles on its own once the address is assigned.
+		if !conf.IsIPv6 {
+			addresses = append(addresses, boship.NewSimpleInterfaceAddress(conf.Name, conf.Address))
+		}
+	}
+
+	for _, conf := range dhcpConfigs {
+		// DHCP interfaces don't have a known address until they're brought
+		// up, so their address has to be resolved rather than read directly.
+		addresses = append(addresses, boship.NewResolvingInterfaceAddress(conf.Name, net.ipResolver))
+	}
+
+	go func() {
+		net.addressBroadcaster.BroadcastMACAddresses(addresses)
+		if errCh != nil {
+			errCh <- nil
+		}
+	}()
+
+	return nil
+}
+
+// writeDhclientConfig writes /etc/dhcp/dhclient.conf so that any DHCP
+// interface prepends our chosen DNS servers ahead of whatever the DHCP
+// server itself offers.
+func (net ubuntuNetManager) writeDhclientConfig(dnsServers []string) error {
 	buffer := bytes.NewBuffer([]byte{})
 	t := template.Must(template.New("dhcp-config").Parse(ubuntuDHCPConfigTemplate))
 
 	// Keep DNS servers in the order specified by the network
 	// because they are added by a *single* DHCP's prepend command
-	dnsNetwork, _ := networks.DefaultNetworkFor("dns")
-	dnsServersList := strings.Join(dnsNetwork.DNS, ", ")
-	err = t.Execute(buffer, dnsServersList)
+	dnsServersList := strings.Join(dnsServers, ", ")
+	err := t.Execute(buffer, dnsServersList)
 	if err != nil {
 		return bosherr.WrapError(err, "Generating config from template")
 	}
@@ -86,19 +170,6 @@ func (net ubuntuNetManager) SetupDhcp(networks boshsettings.Networks, errCh chan
 		}
 	}
 
-	addresses := []boship.InterfaceAddress{
-		// eth0 is hard coded in AWS and OpenStack stemcells.
-		// TODO: abstract hardcoded network interface name to the Manager
-		boship.NewResolvingInterfaceAddress("eth0", net.ipResolver),
-	}
-
-	go func() {
-		net.addressBroadcaster.BroadcastMACAddresses(addresses)
-		if errCh != nil {
-			errCh <- nil
-		}
-	}()
-
 	return nil
 }
 
@@ -118,216 +189,94 @@ request subnet-mask, broadcast-address, time-offset, routers,
 prepend domain-name-servers {{ . }};{{ end }}
 `
 
-func (net ubuntuNetManager) SetupManualNetworking(networks boshsettings.Networks, errCh chan error) error {
-	net.logger.Debug(ubuntuNetManagerLogTag, "Configuring manual networking")
-
-	modifiedNetworks, written, err := net.writeNetworkInterfaces(networks)
+func (net ubuntuNetManager) writeNetworkInterfaces(networks boshsettings.Networks) ([]StaticInterfaceConfiguration, []DHCPInterfaceConfiguration, bool, error) {
+	macAddresses, err := net.macAddressDetector.DetectMacAddresses()
 	if err != nil {
-		return bosherr.WrapError(err, "Writing network interfaces")
-	}
-
-	if written {
-		net.restartNetworkingInterfaces(modifiedNetworks)
+		return nil, nil, false, bosherr.WrapError(err, "Detecting mac addresses")
 	}
 
-	addresses := toInterfaceAddresses(modifiedNetworks)
-
-	go func() {
-		net.addressBroadcaster.BroadcastMACAddresses(addresses)
-		if errCh != nil {
-			errCh <- nil
-		}
-	}()
-
-	return nil
-}
-
-func (net ubuntuNetManager) writeNetworkInterfaces(networks boshsettings.Networks) ([]customNetwork, bool, error) {
-	var modifiedNetworks []customNetwork
-
-	macAddresses, err := net.detectMacAddresses()
+	staticConfigs, dhcpConfigs, err := net.interfaceConfigurationCreator.CreateInterfaceConfigurations(networks, macAddresses)
 	if err != nil {
-		return modifiedNetworks, false, bosherr.WrapError(err, "Detecting mac addresses")
-	}
-
-	for _, aNet := range networks {
-		network, broadcast, err := boshsys.CalculateNetworkAndBroadcast(aNet.IP, aNet.Netmask)
-		if err != nil {
-			return modifiedNetworks, false, bosherr.WrapError(err, "Calculating network and broadcast")
-		}
-
-		newNet := customNetwork{
-			aNet,
-			macAddresses[aNet.Mac],
-			network,
-			broadcast,
-			true,
-		}
-		modifiedNetworks = append(modifiedNetworks, newNet)
+		return nil, nil, false, bosherr.WrapError(err, "Creating interface configurations")
 	}
 
 	networkInterfaceValues := networkInterfaceConfigArg{
-		Networks:          modifiedNetworks,
-		HasDNSNameServers: false,
+		Static: staticConfigs,
+		DHCP:   dhcpConfigs,
 	}
 
 	buffer := bytes.NewBuffer([]byte{})
 
-	dnsNetwork, _ := networks.DefaultNetworkFor("dns")
-	networkInterfaceValues.HasDNSNameServers = true
-	networkInterfaceValues.DNSServers = dnsNetwork.DNS
-
 	t := template.Must(template.New("network-interfaces").Parse(networkInterfacesTemplate))
 
 	err = t.Execute(buffer, networkInterfaceValues)
 	if err != nil {
-		return modifiedNetworks, false, bosherr.WrapError(err, "Generating config from template")
+		return nil, nil, false, bosherr.WrapError(err, "Generating config from template")
 	}
 
 	written, err := net.fs.ConvergeFileContents("/etc/network/interfaces", buffer.Bytes())
 	if err != nil {
-		return modifiedNetworks, false, bosherr.WrapError(err, "Writing to /etc/network/interfaces")
+		return nil, nil, false, bosherr.WrapError(err, "Writing to /etc/network/interfaces")
 	}
 
-	return modifiedNetworks, written, nil
+	return staticConfigs, dhcpConfigs, written, nil
+}
+
+type networkInterfaceConfigArg struct {
+	Static []StaticInterfaceConfiguration
+	DHCP   []DHCPInterfaceConfiguration
 }
 
 const networkInterfacesTemplate = `# Generated by bosh-agent
 auto lo
 iface lo inet loopback
-{{ range .Networks }}
-auto {{ .Interface }}
-iface {{ .Interface }} inet static
-    address {{ .IP }}
-    network {{ .NetworkIP }}
+{{ range .Static }}
+auto {{ .Name }}
+{{ if .IsIPv6 }}iface {{ .Name }} inet6 static
+    address {{ .Address }}
+    netmask {{ .Netmask }}
+{{ if .Gateway }}    gateway {{ .Gateway }}{{ end }}
+{{ else }}iface {{ .Name }} inet static
+    address {{ .Address }}
+    network {{ .Network }}
     netmask {{ .Netmask }}
     broadcast {{ .Broadcast }}
-{{ if .HasDefaultGateway }}    gateway {{ .Gateway }}{{ end }}{{ end }}
-{{ if .HasDNSNameServers }}dns-nameservers{{ range .DNSServers }} {{ . }}{{ end }}{{ end }}`
-
-func (net ubuntuNetManager) writeResolvConf(networks boshsettings.Networks) error {
-	net.logger.Debug(ubuntuNetManagerLogTag, "Writing resolv.conf")
-
-	buffer := bytes.NewBuffer([]byte{})
-	t := template.Must(template.New("resolv-conf").Parse(ubuntuResolvConfTemplate))
-
-	// Keep DNS servers in the order specified by the network
-	dnsNetwork, _ := networks.DefaultNetworkFor("dns")
-	dnsServersArg := dnsConfigArg{dnsNetwork.DNS}
-	err := t.Execute(buffer, dnsServersArg)
-	if err != nil {
-		return bosherr.WrapError(err, "Generating config from template")
-	}
-
-	err = net.fs.WriteFile("/etc/resolv.conf", buffer.Bytes())
-	if err != nil {
-		return bosherr.WrapError(err, "Writing to /etc/resolv.conf")
-	}
-
-	return nil
-}
-
-const ubuntuResolvConfTemplate = `# Generated by bosh-agent
-{{ range .DNSServers }}nameserver {{ . }}
+{{ if .Gateway }}    gateway {{ .Gateway }}{{ end }}
+{{ end }}{{ end }}
+{{ range .DHCP }}
+auto {{ .Name }}
+iface {{ .Name }} inet dhcp
 {{ end }}`
 
-func (net ubuntuNetManager) detectMacAddresses() (map[string]string, error) {
-	addresses := map[string]string{}
-
-	filePaths, err := net.fs.Glob("/sys/class/net/*")
-	if err != nil {
-		return addresses, bosherr.WrapError(err, "Getting file list from /sys/class/net")
-	}
-
-	var macAddress string
-	for _, filePath := range filePaths {
-		macAddress, err = net.fs.ReadFileString(filepath.Join(filePath, "address"))
-		if err != nil {
-			return addresses, bosherr.WrapError(err, "Reading mac address from file")
-		}
-
-		macAddress = strings.Trim(macAddress, "\n")
-
-		interfaceName := filepath.Base(filePath)
-		addresses[macAddress] = interfaceName
-	}
-
-	return addresses, nil
-}
-
-func (net ubuntuNetManager) restartNetworkingInterfaces(networks []customNetwork) {
-	for _, network := range networks {
-		net.logger.Debug(ubuntuNetManagerLogTag, "Restarting network interface %s", network.Interface)
+func (net ubuntuNetManager) restartNetworkingInterfaces(staticConfigs []StaticInterfaceConfiguration, dhcpConfigs []DHCPInterfaceConfiguration) {
+	restart := func(interfaceName string) {
+		net.logger.Debug(ubuntuNetManagerLogTag, "Restarting network interface %s", interfaceName)
 
-		_, _, _, err := net.cmdRunner.RunCommand("service", "network-interface", "stop", "INTERFACE="+network.Interface)
+		_, _, _, err := net.cmdRunner.RunCommand("service", "network-interface", "stop", "INTERFACE="+interfaceName)
 		if err != nil {
 			net.logger.Error(ubuntuNetManagerLogTag, "Ignoring network stop failure: %s", err.Error())
 		}
 
-		_, _, _, err = net.cmdRunner.RunCommand("service", "network-interface", "start", "INTERFACE="+network.Interface)
+		_, _, _, err = net.cmdRunner.RunCommand("service", "network-interface", "start", "INTERFACE="+interfaceName)
 		if err != nil {
 			net.logger.Error(ubuntuNetManagerLogTag, "Ignoring network start failure: %s", err.Error())
 		}
 	}
-}
 
-func (net ubuntuNetManager) restartNetworkArguments() []string {
-	_, _, _, err := net.cmdRunner.RunCommand("ifup", "--version")
-	if err != nil {
-		net.logger.Error(ubuntuNetManagerLogTag, "Ignoring ifup version failure: %s", err.Error())
+	for _, conf := range staticConfigs {
+		restart(conf.Name)
 	}
 
-	return []string{"-a", "--no-loopback"}
-}
-
-func (net ubuntuNetManager) writeDhcpNetworkInterfaces() error {
-	interfaces, err := net.detectNetworkInterfaces()
-	if err != nil {
-		return bosherr.WrapError(err, "Detecting network interfaces")
+	for _, conf := range dhcpConfigs {
+		restart(conf.Name)
 	}
-
-	buffer := bytes.NewBuffer([]byte{})
-	t := template.Must(template.New("network-interfaces").Parse(ubuntuDhcpNetworkInterfacesTemplate))
-
-	err = t.Execute(buffer, interfaces)
-	if err != nil {
-		return bosherr.WrapError(err, "Generating config from template")
-	}
-
-	_, err = net.fs.ConvergeFileContents("/etc/network/interfaces", buffer.Bytes())
-	if err != nil {
-		return bosherr.WrapError(err, "Writing to /etc/network/interfaces")
-	}
-
-	return nil
 }
 
-const ubuntuDhcpNetworkInterfacesTemplate = `# Generated by bosh-agent
-auto lo
-iface lo inet loopback
-{{ range . }}
-auto {{ . }}
-iface {{ . }} inet dhcp
-{{ end }}`
-
-func (net ubuntuNetManager) detectNetworkInterfaces() ([]string, error) {
-	interfaces := []string{}
-
-	filePaths, err := net.fs.Glob("/sys/class/net/*")
+func (net ubuntuNetManager) restartNetworkArguments() []string {
+	_, _, _, err := net.cmdRunner.RunCommand("ifup", "--version")
 	if err != nil {
-		return nil, bosherr.WrapError(err, "Getting file list from /sys/class/net")
-	}
-
-	for _, filePath := range filePaths {
-		exists := net.fs.FileExists(filepath.Join(filePath, "device"))
-		if !exists {
-			net.logger.Info(ubuntuNetManagerLogTag, "Ignoring virtual network device: %s", filePath)
-			continue
-		}
-
-		interfaceName := filepath.Base(filePath)
-		interfaces = append(interfaces, interfaceName)
+		net.logger.Error(ubuntuNetManagerLogTag, "Ignoring ifup version failure: %s", err.Error())
 	}
 
-	return interfaces, nil
+	return []string{"-a", "--no-loopback"}
 }
@@ -0,0 +1,50 @@
+package net
+
+import (
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+// WindowsMACAddressDetector shells out to Get-NetAdapter since Windows
+// guests have no /sys/class/net to read.
+type WindowsMACAddressDetector struct {
+	cmdRunner boshsys.CmdRunner
+}
+
+func NewWindowsMACAddressDetector(cmdRunner boshsys.CmdRunner) WindowsMACAddressDetector {
+	return WindowsMACAddressDetector{cmdRunner: cmdRunner}
+}
+
+func (d WindowsMACAddressDetector) DetectMacAddresses() (map[string]string, error) {
+	addresses := map[string]string{}
+
+	stdout, _, _, err := d.cmdRunner.RunCommand(
+		"powershell",
+		"-Command",
+		"Get-NetAdapter | Select-Object -Property Name,MacAddress | ConvertTo-Csv -NoTypeInformation",
+	)
+	if err != nil {
+		return addresses, bosherr.WrapError(err, "Getting network adapters")
+	}
+
+	for i, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		if i == 0 {
+			// CSV header row
+			continue
+		}
+
+		fields := strings.Split(strings.Trim(line, "\r"), ",")
+		if len(fields) != 2 {
+			continue
+		}
+
+		interfaceName := strings.Trim(fields[0], `"`)
+		macAddress := strings.ToLower(strings.ReplaceAll(strings.Trim(fields[1], `"`), "-", ":"))
+
+		addresses[macAddress] = interfaceName
+	}
+
+	return addresses, nil
+}